@@ -0,0 +1,41 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ibm-messaging/mq-container/internal/coordination"
+)
+
+// newMultiInstanceCoordinator builds the coordination.Coordinator selected by
+// the MQ_MI_COORDINATOR environment variable ("fs", the default, or "etcd"),
+// configured from MQ_MI_COORDINATOR_ENDPOINTS where applicable.
+func newMultiInstanceCoordinator(dataMount string) (coordination.Coordinator, error) {
+	switch backend := os.Getenv("MQ_MI_COORDINATOR"); backend {
+	case "", "fs":
+		return coordination.NewFilesystemCoordinator(dataMount), nil
+	case "etcd":
+		endpoints := os.Getenv("MQ_MI_COORDINATOR_ENDPOINTS")
+		if endpoints == "" {
+			return nil, fmt.Errorf("MQ_MI_COORDINATOR_ENDPOINTS must be set when MQ_MI_COORDINATOR=etcd")
+		}
+		return coordination.NewEtcdCoordinator(endpoints, 0)
+	default:
+		return nil, fmt.Errorf("unrecognised MQ_MI_COORDINATOR %q: expected \"fs\" or \"etcd\"", backend)
+	}
+}
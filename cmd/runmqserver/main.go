@@ -0,0 +1,48 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command runmqserver is the container entrypoint that configures and starts
+// a queue manager. Only the multi-instance startup path (flock/etcd
+// coordination and the event-driven supervisor) is implemented here; the
+// single-instance startup path and the mount validation that precedes both
+// predate this series and live elsewhere in the real runmqserver entrypoint.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	if os.Getenv("MQ_MULTI_INSTANCE") == "true" {
+		if err := runMultiInstance(ctx, os.Getenv("MQ_QMGR_NAME")); err != nil {
+			log.Fatalf("multi-instance startup failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ibm-messaging/mq-container/internal/coordination"
+)
+
+// multiInstanceDataMount is the shared data mount multi-instance queue
+// managers are required to be started against; it is also where
+// FilesystemCoordinator's lockfile lives.
+const multiInstanceDataMount = "/mnt/mqm-data"
+
+// runMultiInstance is the multi-instance entry point: it builds the
+// coordinator selected by MQ_MI_COORDINATOR, then either runs the
+// configure/start sequence as a hot standby (for backends that support it,
+// such as FilesystemCoordinator) or as a single leased active owner (for
+// backends that don't, such as EtcdCoordinator), and keeps the supervisor
+// watchdog running for as long as ctx is not cancelled. Mount validation for
+// /mnt/mqm, /mnt/mqm-log and /mnt/mqm-data predates this series and happens
+// upstream of this call, in the rest of the runmqserver entrypoint.
+func runMultiInstance(ctx context.Context, qmName string) error {
+	coordinator, err := newMultiInstanceCoordinator(multiInstanceDataMount)
+	if err != nil {
+		return fmt.Errorf("failed to create multi-instance coordinator: %v", err)
+	}
+
+	go monitorActiveLease(ctx, coordinator, qmName)
+
+	if hotStandby, ok := coordinator.(coordination.HotStandbyCoordinator); ok {
+		return runHotStandbyMultiInstance(ctx, hotStandby, qmName)
+	}
+	return runLeasedMultiInstance(ctx, coordinator, qmName)
+}
+
+// runHotStandbyMultiInstance implements the race described by this backlog
+// item: both containers race to become active via TryAcquireActive. The
+// winner runs crtmqm/config and starts as active, then downgrades its lease
+// to shared; the loser blocks in AcquireStandby until that downgrade (or an
+// outright Release) happens, then starts directly as a hot standby via
+// `strmqm -x`. Both then run side by side, supervised until ctx is
+// cancelled.
+func runHotStandbyMultiInstance(ctx context.Context, c coordination.HotStandbyCoordinator, qmName string) error {
+	lease, won, err := c.TryAcquireActive(ctx, qmName)
+	if err != nil {
+		return fmt.Errorf("failed to attempt active role for %v: %v", qmName, err)
+	}
+
+	if won {
+		if err := configureAndStartActive(qmName); err != nil {
+			c.Release(context.Background(), lease)
+			return err
+		}
+		lease, err = c.DowngradeToStandby(ctx, lease)
+		if err != nil {
+			return fmt.Errorf("failed to downgrade active lease for %v to standby: %v", qmName, err)
+		}
+	} else {
+		lease, err = c.AcquireStandby(ctx, qmName)
+		if err != nil {
+			return fmt.Errorf("failed to acquire standby role for %v: %v", qmName, err)
+		}
+		if err := startStandby(qmName); err != nil {
+			return err
+		}
+	}
+
+	startSupervisor(ctx, qmName)
+
+	<-ctx.Done()
+	return c.Release(context.Background(), lease)
+}
+
+// runLeasedMultiInstance handles backends without a shared-lock/hot-standby
+// primitive, which model a single active owner instead: it acquires the
+// active role, configures and starts the queue manager, then keeps the
+// lease renewed until it is lost or ctx is cancelled. If a renewal ever
+// fails -- the lease having been lost, for example to a network partition --
+// it gracefully shuts the queue manager down with `endmqm -i` well before the
+// lease can expire and a standby be promoted elsewhere, avoiding a window
+// where two containers both believe they are active.
+func runLeasedMultiInstance(ctx context.Context, c coordination.Coordinator, qmName string) error {
+	lease, err := c.AcquireActive(ctx, qmName)
+	if err != nil {
+		return fmt.Errorf("failed to acquire active role for %v: %v", qmName, err)
+	}
+	if err := configureAndStartActive(qmName); err != nil {
+		c.Release(context.Background(), lease)
+		return err
+	}
+
+	startSupervisor(ctx, qmName)
+
+	if lease.TTL == 0 {
+		<-ctx.Done()
+		return c.Release(context.Background(), lease)
+	}
+
+	renewInterval := lease.TTL / 3
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return c.Release(context.Background(), lease)
+		case <-ticker.C:
+			// Bound each renewal by renewInterval, so a renewal that hangs
+			// (an unreachable backend) fails, and endmqm runs, at most
+			// 2*TTL/3 after the last successful renewal.
+			renewCtx, cancelRenew := context.WithTimeout(ctx, renewInterval)
+			renewed, err := c.Renew(renewCtx, lease)
+			cancelRenew()
+			if err != nil {
+				log.Printf("lost active lease for %v, ending it gracefully to avoid split-brain: %v", qmName, err)
+				return endMultiInstanceQueueManager(qmName)
+			}
+			lease = renewed
+		}
+	}
+}
+
+// monitorActiveLease watches for unexpected loss of qmName's active lease via
+// the coordinator's WatchActive, logging a warning if one is reported. Not
+// every backend supports watching -- FilesystemCoordinator relies on flock
+// semantics in AcquireActive/AcquireStandby instead -- in which case this
+// simply returns.
+func monitorActiveLease(ctx context.Context, c coordination.Coordinator, qmName string) {
+	events, err := c.WatchActive(ctx, qmName)
+	if err != nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Lost {
+				log.Printf("coordinator reported the active lease for %v was lost", qmName)
+			}
+		}
+	}
+}
+
+// configureAndStartActive runs crtmqm (tolerating "already exists", which is
+// expected on a restart) followed by strmqm, to configure and start qmName
+// as the active instance.
+func configureAndStartActive(qmName string) error {
+	if out, err := exec.Command("crtmqm", "-q", qmName).CombinedOutput(); err != nil {
+		if !strings.Contains(string(out), "already exists") {
+			return fmt.Errorf("failed to create queue manager %v: %v: %v", qmName, err, string(out))
+		}
+	}
+	if out, err := exec.Command("strmqm", qmName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start queue manager %v: %v: %v", qmName, err, string(out))
+	}
+	return nil
+}
+
+// startStandby runs `strmqm -x` to start qmName as a hot standby instance.
+func startStandby(qmName string) error {
+	if out, err := exec.Command("strmqm", "-x", qmName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start queue manager %v as standby: %v: %v", qmName, err, string(out))
+	}
+	return nil
+}
+
+// endMultiInstanceQueueManager runs `endmqm -i` to stop qmName as a
+// multi-instance queue manager, so that a standby holding (or about to hold)
+// the active role can take over cleanly.
+func endMultiInstanceQueueManager(qmName string) error {
+	out, err := exec.Command("endmqm", "-i", qmName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to end queue manager %v: %v: %v", qmName, err, string(out))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/ibm-messaging/mq-container/internal/supervisor"
+)
+
+// qmEventsSocket is the well-known path the supervisor's event stream is
+// exposed on, so that both operator tooling and the test suite can watch for
+// state transitions instead of sleeping and polling dspmq.
+const qmEventsSocket = "/run/mqm/qm-events.sock"
+
+// qmHookDir is where operators can drop executable scripts (on-active,
+// on-standby, on-ended, on-sigterm) to be run on each transition.
+const qmHookDir = "/etc/mqm/hooks"
+
+// startSupervisor starts the watchdog goroutine for qmName and exposes its
+// event stream over qmEventsSocket, running until ctx is cancelled.
+func startSupervisor(ctx context.Context, qmName string) {
+	qmCtx := supervisor.NewQMContext(qmName, qmHookDir)
+	go qmCtx.Run(ctx)
+	go func() {
+		if err := supervisor.ServeEvents(ctx, qmEventsSocket, qmCtx); err != nil {
+			log.Printf("supervisor event stream on %v stopped: %v", qmEventsSocket, err)
+		}
+	}()
+}
@@ -0,0 +1,113 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package coordination provides pluggable backends for deciding which of two
+// or more containers sharing a multi-instance queue manager's volumes is
+// currently active, and for notifying the others when that changes so a
+// standby can promote itself.
+package coordination
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotActive is returned by Renew, Release and DowngradeToStandby when
+// called with a lease that carries no state of that Coordinator's backend,
+// such as the zero Lease or one issued by a different backend. A lease that
+// has already expired or been released is reported by the backend's own
+// error instead, or, for FilesystemCoordinator's Renew, not at all.
+var ErrNotActive = errors.New("coordination: lease is not active")
+
+// Lease represents having been granted the active role for a queue manager by
+// a Coordinator. Its zero value is not valid; leases are only created by a
+// successful call to AcquireActive, or to a HotStandbyCoordinator's
+// TryAcquireActive or AcquireStandby.
+type Lease struct {
+	// QMName is the queue manager this lease grants active ownership of.
+	QMName string
+	// TTL is the duration the backend guarantees to honour the lease for
+	// without a Renew call. Implementations with no notion of expiry, such as
+	// FilesystemCoordinator, leave this zero.
+	TTL time.Duration
+	// token carries opaque, backend-specific lease state, such as an etcd
+	// lease ID or an open file handle.
+	token interface{}
+}
+
+// ActiveChangeEvent is sent on the channel returned by WatchActive whenever
+// the active container for a queue manager changes.
+type ActiveChangeEvent struct {
+	// Lost is true when the previous active container's lease has expired or
+	// been released, and no replacement has been observed taking over yet.
+	Lost bool
+}
+
+// Coordinator decides which of several containers sharing a multi-instance
+// queue manager's volumes should run as active, and notifies the others when
+// that changes so they can promote themselves.
+type Coordinator interface {
+	// AcquireActive blocks until the caller is granted the active role for
+	// qmName, or ctx is cancelled. Implementations must guarantee at most one
+	// caller holds the active role for a given qmName at a time.
+	AcquireActive(ctx context.Context, qmName string) (Lease, error)
+
+	// WatchActive returns a channel that receives an event whenever the
+	// active container for qmName changes, so a standby can promote itself as
+	// soon as the current active one is lost. The channel is closed when ctx
+	// is cancelled.
+	WatchActive(ctx context.Context, qmName string) (<-chan ActiveChangeEvent, error)
+
+	// Renew extends lease before its TTL expires. Callers holding a lease
+	// with a non-zero TTL must call Renew periodically, well within the TTL,
+	// to avoid losing active status and causing an unwanted promotion.
+	Renew(ctx context.Context, lease Lease) (Lease, error)
+
+	// Release gives up lease, allowing another container to be granted the
+	// active role. Implementations should make a best effort to call this on
+	// graceful shutdown of the active container, ahead of the lease expiring,
+	// to avoid split-brain during the handover.
+	Release(ctx context.Context, lease Lease) error
+}
+
+// HotStandbyCoordinator is an optional capability implemented by backends
+// that support MQ's native hot-standby model: the winner of the race holds
+// an exclusive lease only for as long as it takes to run crtmqm/config, then
+// downgrades to a shared lease so any number of standbys can run
+// concurrently as `strmqm -x`. Backends that instead model a single active
+// owner for its whole lifetime (such as EtcdCoordinator) do not implement
+// this, and callers should fall back to plain Coordinator semantics.
+type HotStandbyCoordinator interface {
+	Coordinator
+
+	// TryAcquireActive makes a single non-blocking attempt to become the
+	// winner for qmName. If won is true, the caller should configure and
+	// start the queue manager, then call DowngradeToStandby; if false, no
+	// lease is returned and the caller should call AcquireStandby instead.
+	TryAcquireActive(ctx context.Context, qmName string) (lease Lease, won bool, err error)
+
+	// DowngradeToStandby converts a lease obtained via TryAcquireActive from
+	// exclusive to shared, once the winner's configure/start sequence is
+	// complete.
+	DowngradeToStandby(ctx context.Context, lease Lease) (Lease, error)
+
+	// AcquireStandby blocks until the caller can hold qmName's lease
+	// concurrently with the active container -- i.e. until the active
+	// container has called DowngradeToStandby or Release -- so the caller
+	// can safely start running as a hot standby alongside it.
+	AcquireStandby(ctx context.Context, qmName string) (Lease, error)
+}
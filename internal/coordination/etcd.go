@@ -0,0 +1,172 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package coordination
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// DefaultEtcdLeaseTTL is used for the etcd lease backing a Lease when no TTL
+// is given to NewEtcdCoordinator.
+const DefaultEtcdLeaseTTL = 10 * time.Second
+
+// EtcdCoordinator implements Coordinator on top of an etcd cluster, using a
+// TTL'd lease attached to a single key per queue manager
+// (/mq-container/<qmName>/active) and a watch on that key to notify standbys
+// when the active container is lost. Unlike FilesystemCoordinator, this does
+// not depend on POSIX advisory locking, so it also works on NFSv3, CSI
+// drivers that forbid flock, and object-backed volumes.
+type EtcdCoordinator struct {
+	Client   *clientv3.Client
+	LeaseTTL time.Duration
+}
+
+// NewEtcdCoordinator returns a Coordinator backed by an etcd client dialled
+// against the comma-separated endpoints. leaseTTL defaults to
+// DefaultEtcdLeaseTTL if zero.
+func NewEtcdCoordinator(endpoints string, leaseTTL time.Duration) (*EtcdCoordinator, error) {
+	if leaseTTL <= 0 {
+		leaseTTL = DefaultEtcdLeaseTTL
+	}
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create etcd client for %v: %v", endpoints, err)
+	}
+	return &EtcdCoordinator{Client: cli, LeaseTTL: leaseTTL}, nil
+}
+
+func activeKey(qmName string) string {
+	return fmt.Sprintf("/mq-container/%v/active", qmName)
+}
+
+// AcquireActive creates a TTL'd etcd lease and attempts to claim the active
+// key for qmName under that lease, only succeeding if the key does not
+// already exist. If another container currently holds the key, it waits for
+// the key to be deleted (the previous lease expiring or being released) and
+// then retries.
+func (c *EtcdCoordinator) AcquireActive(ctx context.Context, qmName string) (Lease, error) {
+	key := activeKey(qmName)
+	for {
+		leaseResp, err := c.Client.Grant(ctx, int64(c.LeaseTTL.Seconds()))
+		if err != nil {
+			return Lease{}, fmt.Errorf("failed to create etcd lease for %v: %v", qmName, err)
+		}
+
+		txn := c.Client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(clientv3.OpPut(key, hostPID(), clientv3.WithLease(leaseResp.ID))).
+			Else(clientv3.OpGet(key))
+		resp, err := txn.Commit()
+		if err != nil {
+			return Lease{}, fmt.Errorf("failed to commit active-key transaction for %v: %v", qmName, err)
+		}
+		if resp.Succeeded {
+			return Lease{QMName: qmName, TTL: c.LeaseTTL, token: leaseResp.ID}, nil
+		}
+
+		// Another container already holds the key: give up our unused lease
+		// and wait for the holder's key to be deleted before trying again.
+		// Watching from the transaction's own revision (rather than "now")
+		// means a delete that lands in the gap between the failed Txn and
+		// the Watch call starting is still observed, instead of being missed.
+		c.Client.Revoke(ctx, leaseResp.ID)
+		if err := c.waitForDelete(ctx, key, resp.Header.Revision); err != nil {
+			return Lease{}, err
+		}
+	}
+}
+
+// waitForDelete blocks until key is deleted in etcd at or after fromRevision,
+// or ctx is cancelled.
+func (c *EtcdCoordinator) waitForDelete(ctx context.Context, key string, fromRevision int64) error {
+	watch := c.Client.Watch(ctx, key, clientv3.WithRev(fromRevision))
+	for resp := range watch {
+		for _, ev := range resp.Events {
+			if ev.Type == clientv3.EventTypeDelete {
+				return nil
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// WatchActive watches the active key for qmName and emits an
+// ActiveChangeEvent with Lost set whenever it is deleted, so the standby can
+// promote itself.
+func (c *EtcdCoordinator) WatchActive(ctx context.Context, qmName string) (<-chan ActiveChangeEvent, error) {
+	key := activeKey(qmName)
+	out := make(chan ActiveChangeEvent)
+	watch := c.Client.Watch(ctx, key)
+	go func() {
+		defer close(out)
+		for resp := range watch {
+			for _, ev := range resp.Events {
+				if ev.Type == clientv3.EventTypeDelete {
+					select {
+					case out <- ActiveChangeEvent{Lost: true}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Renew refreshes lease's underlying etcd lease. Callers must call this well
+// within LeaseTTL to avoid the active key expiring and a standby being
+// promoted while the caller is still running.
+func (c *EtcdCoordinator) Renew(ctx context.Context, lease Lease) (Lease, error) {
+	id, ok := lease.token.(clientv3.LeaseID)
+	if !ok {
+		return Lease{}, ErrNotActive
+	}
+	if _, err := c.Client.KeepAliveOnce(ctx, id); err != nil {
+		return Lease{}, fmt.Errorf("failed to renew etcd lease for %v: %v", lease.QMName, err)
+	}
+	return lease, nil
+}
+
+// Release revokes lease's underlying etcd lease, deleting the active key and
+// unblocking any standby waiting in AcquireActive or WatchActive. Callers
+// must call Release before their lease's TTL expires in order to hand off
+// cleanly and avoid a window where no container is active.
+func (c *EtcdCoordinator) Release(ctx context.Context, lease Lease) error {
+	id, ok := lease.token.(clientv3.LeaseID)
+	if !ok {
+		return ErrNotActive
+	}
+	_, err := c.Client.Revoke(ctx, id)
+	return err
+}
+
+func hostPID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%v %v", hostname, os.Getpid())
+}
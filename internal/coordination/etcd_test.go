@@ -0,0 +1,189 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package coordination
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startEmbeddedEtcd starts an in-process etcd server for the lifetime of t,
+// returning a client dialled against it.
+func startEmbeddedEtcd(t *testing.T) *clientv3.Client {
+	dir := t.TempDir()
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	clientURL, err := url.Parse("http://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerURL, err := url.Parse("http://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ListenClientUrls = []url.URL{*clientURL}
+	cfg.ListenPeerUrls = []url.URL{*peerURL}
+
+	etcdServer, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(etcdServer.Close)
+
+	select {
+	case <-etcdServer.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("embedded etcd took too long to become ready")
+	}
+
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{etcdServer.Clients[0].Addr().String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	return cli
+}
+
+func TestEtcdCoordinatorAcquireReleaseRoundTrip(t *testing.T) {
+	c := &EtcdCoordinator{Client: startEmbeddedEtcd(t), LeaseTTL: DefaultEtcdLeaseTTL}
+
+	lease, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.QMName != "QM1" {
+		t.Fatalf("got QMName %v, want QM1", lease.QMName)
+	}
+	if err := c.Release(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestEtcdCoordinatorSecondAcquireWaitsForRelease checks that a second caller
+// blocks in AcquireActive while the first lease is held, including across the
+// revision-based wait in waitForDelete, and is unblocked as soon as the first
+// lease is released.
+func TestEtcdCoordinatorSecondAcquireWaitsForRelease(t *testing.T) {
+	cli := startEmbeddedEtcd(t)
+	c := &EtcdCoordinator{Client: cli, LeaseTTL: DefaultEtcdLeaseTTL}
+
+	first, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		second, err := c.AcquireActive(context.Background(), "QM1")
+		if err != nil {
+			return
+		}
+		close(acquired)
+		c.Release(context.Background(), second)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second AcquireActive succeeded while the first lease was still held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := c.Release(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second AcquireActive did not succeed after the first lease was released")
+	}
+}
+
+// TestEtcdCoordinatorWatchActiveObservesLoss checks that a watcher started
+// against WatchActive is notified when the active lease is released.
+func TestEtcdCoordinatorWatchActiveObservesLoss(t *testing.T) {
+	cli := startEmbeddedEtcd(t)
+	c := &EtcdCoordinator{Client: cli, LeaseTTL: DefaultEtcdLeaseTTL}
+
+	lease, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.WatchActive(ctx, "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Release(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("events channel closed before an event was delivered")
+		}
+		if !event.Lost {
+			t.Fatalf("got event %+v, want Lost=true", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for WatchActive to report the lease being released")
+	}
+}
+
+// TestEtcdCoordinatorRenewExtendsLease checks that Renew keeps a lease alive
+// past what its TTL would otherwise allow.
+func TestEtcdCoordinatorRenewExtendsLease(t *testing.T) {
+	cli := startEmbeddedEtcd(t)
+	c := &EtcdCoordinator{Client: cli, LeaseTTL: 2 * time.Second}
+
+	lease, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Release(context.Background(), lease)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := c.Renew(context.Background(), lease); err != nil {
+			t.Fatalf("Renew failed before the lease expired: %v", err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if _, err := c.AcquireActive(contextWithTimeout(t, 200*time.Millisecond), "QM1"); err == nil {
+		t.Fatal("expected the renewed lease to still be held, blocking a second AcquireActive")
+	}
+}
+
+func contextWithTimeout(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}
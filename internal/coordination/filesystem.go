@@ -0,0 +1,216 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package coordination
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// flockPollInterval is how often AcquireActive retries a non-blocking flock
+// attempt while waiting for the current holder to release it, so that it can
+// also notice ctx being cancelled in a timely fashion.
+const flockPollInterval = 200 * time.Millisecond
+
+// filesystemLockFile is the well-known name of the lockfile created under a
+// shared data mount to coordinate which container runs the create/upgrade/
+// start sequence for a multi-instance queue manager.
+const filesystemLockFile = ".mq-container.lock"
+
+// FilesystemCoordinator implements Coordinator using an flock(2) exclusive
+// lock on a well-known file under the queue manager's shared data mount. It
+// is the default coordination backend, preserving the behaviour multi-instance
+// queue managers have always relied on when qmshareddata/qmsharedlogs are
+// backed by a filesystem with POSIX advisory locking semantics. Because the
+// lock is held by the kernel against an open file descriptor, it has no TTL
+// and is automatically released if the active container crashes.
+type FilesystemCoordinator struct {
+	// DataMount is the shared data mount (e.g. /mnt/mqm-data) under which the
+	// lockfile is created.
+	DataMount string
+}
+
+// NewFilesystemCoordinator returns a Coordinator that arbitrates the active
+// role via an flock on a lockfile under dataMount.
+func NewFilesystemCoordinator(dataMount string) *FilesystemCoordinator {
+	return &FilesystemCoordinator{DataMount: dataMount}
+}
+
+// AcquireActive opens (creating if necessary) the coordination lockfile and
+// blocks until it can take an exclusive flock on it, or ctx is cancelled.
+// Because flock itself cannot be interrupted by ctx, this polls with a
+// non-blocking attempt on flockPollInterval rather than making a single
+// blocking call, so that cancellation is still honoured promptly. Callers
+// that want MQ's native hot-standby behaviour (winner configures under an
+// exclusive lock, then downgrades to shared so a standby can run
+// concurrently) should use TryAcquireActive, DowngradeToStandby and
+// AcquireStandby instead; AcquireActive is for backends/callers that only
+// need a single, exclusive, whole-lifetime owner.
+func (c *FilesystemCoordinator) AcquireActive(ctx context.Context, qmName string) (Lease, error) {
+	f, err := c.openLockFile()
+	if err != nil {
+		return Lease{}, err
+	}
+	if err := c.flock(ctx, f, syscall.LOCK_EX); err != nil {
+		f.Close()
+		return Lease{}, err
+	}
+	if err := stampLockFile(f); err != nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+		return Lease{}, err
+	}
+	return Lease{QMName: qmName, token: f}, nil
+}
+
+// TryAcquireActive makes a single non-blocking attempt to take the exclusive
+// lock for qmName. If won is true, the caller should run crtmqm/config and
+// then call DowngradeToStandby; if false, no lease is returned and the
+// caller should call AcquireStandby instead to wait its turn to start as a
+// hot standby once the winner downgrades.
+func (c *FilesystemCoordinator) TryAcquireActive(ctx context.Context, qmName string) (lease Lease, won bool, err error) {
+	f, err := c.openLockFile()
+	if err != nil {
+		return Lease{}, false, err
+	}
+	switch err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err {
+	case nil:
+		if err := stampLockFile(f); err != nil {
+			syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+			f.Close()
+			return Lease{}, false, err
+		}
+		return Lease{QMName: qmName, token: f}, true, nil
+	case syscall.EWOULDBLOCK:
+		f.Close()
+		return Lease{}, false, nil
+	default:
+		f.Close()
+		return Lease{}, false, fmt.Errorf("failed to attempt exclusive lock on multi-instance lock file: %v", err)
+	}
+}
+
+// DowngradeToStandby converts a lease obtained via TryAcquireActive (or
+// AcquireActive) from an exclusive lock to a shared one, once the winner's
+// crtmqm/config sequence is complete. Any number of other containers blocked
+// in AcquireStandby can then also hold a shared lock concurrently, matching
+// MQ's hot-standby model of one active plus N running standbys.
+func (c *FilesystemCoordinator) DowngradeToStandby(ctx context.Context, lease Lease) (Lease, error) {
+	f, ok := lease.token.(*os.File)
+	if !ok {
+		return Lease{}, ErrNotActive
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH); err != nil {
+		return Lease{}, fmt.Errorf("failed to downgrade multi-instance lock on %v: %v", f.Name(), err)
+	}
+	return lease, nil
+}
+
+// AcquireStandby opens (creating if necessary) the coordination lockfile and
+// blocks until it can take a shared flock on it, or ctx is cancelled. A
+// shared lock is only available once the active container has downgraded
+// its own lease with DowngradeToStandby (or released it outright), so this
+// is how a container that lost the race in TryAcquireActive waits its turn
+// to start running as a hot standby (`strmqm -x`) alongside the active one.
+func (c *FilesystemCoordinator) AcquireStandby(ctx context.Context, qmName string) (Lease, error) {
+	f, err := c.openLockFile()
+	if err != nil {
+		return Lease{}, err
+	}
+	if err := c.flock(ctx, f, syscall.LOCK_SH); err != nil {
+		f.Close()
+		return Lease{}, err
+	}
+	return Lease{QMName: qmName, token: f}, nil
+}
+
+// openLockFile opens (creating if necessary) the coordination lockfile under
+// c.DataMount.
+func (c *FilesystemCoordinator) openLockFile() (*os.File, error) {
+	path := filepath.Join(c.DataMount, filesystemLockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0660)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open multi-instance lock file %v: %v", path, err)
+	}
+	return f, nil
+}
+
+// flock polls a non-blocking flock(f, how) attempt every flockPollInterval
+// until it succeeds or ctx is cancelled, since the blocking form of flock
+// cannot itself be interrupted by ctx.
+func (c *FilesystemCoordinator) flock(ctx context.Context, f *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err == nil {
+			return nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			return fmt.Errorf("failed to lock %v: %v", f.Name(), err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(flockPollInterval):
+		}
+	}
+}
+
+// WatchActive is not supported by FilesystemCoordinator, so this always
+// errors. A caller blocked in AcquireActive gets the exclusive lock once no
+// other container holds the lockfile (the kernel drops a crashed holder's
+// flock); AcquireStandby instead returns as soon as the winner downgrades,
+// while the winner is still running.
+func (c *FilesystemCoordinator) WatchActive(ctx context.Context, qmName string) (<-chan ActiveChangeEvent, error) {
+	return nil, fmt.Errorf("coordination: WatchActive is not supported by FilesystemCoordinator; block on AcquireActive/AcquireStandby instead")
+}
+
+// Renew is a no-op for FilesystemCoordinator: an flock has no TTL to renew.
+func (c *FilesystemCoordinator) Renew(ctx context.Context, lease Lease) (Lease, error) {
+	return lease, nil
+}
+
+// Release releases the flock underlying lease and closes the file.
+func (c *FilesystemCoordinator) Release(ctx context.Context, lease Lease) error {
+	f, ok := lease.token.(*os.File)
+	if !ok {
+		return ErrNotActive
+	}
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	f.Close()
+	return err
+}
+
+// stampLockFile truncates the lock file and writes the current hostname and
+// PID to it, so operators inspecting the shared volume can tell which
+// container holds (or last held) the lock.
+func stampLockFile(f *os.File) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate multi-instance lock file: %v", err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return fmt.Errorf("failed to seek multi-instance lock file: %v", err)
+	}
+	_, err = fmt.Fprintf(f, "%v %v\n", hostname, os.Getpid())
+	return err
+}
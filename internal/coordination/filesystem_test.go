@@ -0,0 +1,107 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package coordination
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFilesystemCoordinatorAcquireReleaseRoundTrip(t *testing.T) {
+	c := NewFilesystemCoordinator(t.TempDir())
+
+	lease, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.QMName != "QM1" {
+		t.Fatalf("got QMName %v, want QM1", lease.QMName)
+	}
+	if err := c.Release(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFilesystemCoordinatorSecondAcquireBlocksUntilReleased checks that a
+// second caller cannot acquire the active role while the first lease is
+// still held, and is unblocked as soon as it is released.
+func TestFilesystemCoordinatorSecondAcquireBlocksUntilReleased(t *testing.T) {
+	c := NewFilesystemCoordinator(t.TempDir())
+
+	lease, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		second, err := c.AcquireActive(context.Background(), "QM1")
+		if err != nil {
+			return
+		}
+		close(acquired)
+		c.Release(context.Background(), second)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second AcquireActive succeeded while the first lease was still held")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := c.Release(context.Background(), lease); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-acquired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("second AcquireActive did not succeed after the first lease was released")
+	}
+}
+
+// TestFilesystemCoordinatorAcquireActiveHonoursContextCancellation checks
+// that a caller blocked waiting for the lock gives up promptly once its
+// context is cancelled, rather than blocking in the underlying flock call
+// indefinitely.
+func TestFilesystemCoordinatorAcquireActiveHonoursContextCancellation(t *testing.T) {
+	c := NewFilesystemCoordinator(t.TempDir())
+
+	lease, err := c.AcquireActive(context.Background(), "QM1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Release(context.Background(), lease)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.AcquireActive(ctx, "QM1"); err == nil {
+		t.Fatal("expected AcquireActive to fail once ctx was cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("AcquireActive took %v to notice context cancellation", elapsed)
+	}
+}
+
+func TestFilesystemCoordinatorWatchActiveUnsupported(t *testing.T) {
+	c := NewFilesystemCoordinator(t.TempDir())
+	if _, err := c.WatchActive(context.Background(), "QM1"); err == nil {
+		t.Fatal("expected WatchActive to return an error for FilesystemCoordinator")
+	}
+}
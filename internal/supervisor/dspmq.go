@@ -0,0 +1,34 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import "strings"
+
+// parseDspmqStatus extracts the STATUS(...) field from a single line of
+// `dspmq -x -o status` output, e.g. turning
+// "QMNAME(QM1) STATUS(Running as standby)" into "Running as standby".
+func parseDspmqStatus(line string) string {
+	start := strings.Index(line, "STATUS(")
+	if start == -1 {
+		return ""
+	}
+	start += len("STATUS(")
+	end := strings.Index(line[start:], ")")
+	if end == -1 {
+		return ""
+	}
+	return line[start : start+end]
+}
@@ -0,0 +1,40 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import "testing"
+
+func TestParseDspmqStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"active", "QMNAME(QM1) STATUS(Running)", "Running"},
+		{"standby", "QMNAME(QM1) STATUS(Running as standby)", "Running as standby"},
+		{"elsewhere", "QMNAME(QM1) STATUS(Running elsewhere)", "Running elsewhere"},
+		{"ended", "QMNAME(QM1) STATUS(Ended normally)", "Ended normally"},
+		{"no status field", "QMNAME(QM1)", ""},
+		{"empty", "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseDspmqStatus(tc.line); got != tc.want {
+				t.Errorf("parseDspmqStatus(%q) = %q, want %q", tc.line, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// ServeEvents listens on the UNIX socket at socketPath and serves
+// GET /qm/events as a Server-Sent Events stream of c's transition events,
+// until ctx is cancelled. It gives operators (and, internally, the test
+// suite) an authoritative way to wait for a specific transition instead of
+// sleeping and polling dspmq themselves.
+func ServeEvents(ctx context.Context, socketPath string, c *QMContext) error {
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %v: %v", socketPath, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/qm/events", func(w http.ResponseWriter, r *http.Request) {
+		handleEventStream(w, r, c)
+	})
+	server := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// handleEventStream streams c's events to w as they occur, in the standard
+// Server-Sent Events wire format, until the client disconnects.
+func handleEventStream(w http.ResponseWriter, r *http.Request, c *QMContext) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			fmt.Fprintf(w, "event: %v\ndata: {}\n\n", event)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,234 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package supervisor models a running queue manager as an event loop: a
+// watchdog goroutine polls its status and emits typed transition events to
+// any number of subscribers, which can in turn be streamed out over HTTP (see
+// ServeEvents) or used to fire operator-supplied hook scripts.
+package supervisor
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Event identifies a queue manager state transition emitted by a QMContext.
+type Event string
+
+const (
+	// QMStarted is emitted when the watchdog first observes the queue
+	// manager running as active.
+	QMStarted Event = "QMStarted"
+	// QMStandby is emitted when the watchdog observes the queue manager
+	// running as standby.
+	QMStandby Event = "QMStandby"
+	// QMEnded is emitted when the watchdog observes the queue manager is no
+	// longer running in either role.
+	QMEnded Event = "QMEnded"
+	// SigTerm is emitted when the context passed to Run is cancelled (which
+	// runmqserver does on SIGTERM or SIGINT), just before the watchdog stops.
+	// Run does not itself end the queue manager.
+	SigTerm Event = "SigTerm"
+)
+
+// dspmqStatus abstracts running `dspmq -x -o status` so it can be replaced in
+// tests without requiring a real queue manager.
+type dspmqStatus func(qmName string) (string, error)
+
+// QMContext is the authoritative source of a single queue manager's observed
+// state transitions. A watchdog goroutine polls its status on PollInterval
+// and publishes an Event to the hub each time the observed state changes;
+// subscribers (such as the SSE handler in ServeEvents) each get their own
+// copy of every event, and publish also fires the matching hook script.
+type QMContext struct {
+	// QMName is the queue manager this context supervises.
+	QMName string
+	// PollInterval is how often the watchdog polls dspmq for status. Defaults
+	// to 2 seconds if zero.
+	PollInterval time.Duration
+	// HookDir is a directory containing executable scripts named after
+	// events (e.g. HookDir/on-active) to run on each transition. Hooks are
+	// optional: a missing script is not an error.
+	HookDir string
+
+	status dspmqStatus
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	lastEvent   Event
+}
+
+// NewQMContext returns a QMContext supervising qmName, running hook scripts
+// out of hookDir on every transition.
+func NewQMContext(qmName, hookDir string) *QMContext {
+	return &QMContext{
+		QMName:       qmName,
+		PollInterval: 2 * time.Second,
+		HookDir:      hookDir,
+		status:       dspmqQueueManagerStatus,
+		subscribers:  make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe registers a new subscriber and returns a channel of events it
+// will receive from this point on, along with a function to unsubscribe. The
+// channel is primed with the most recently observed transition, if any, so a
+// subscriber that attaches just after a transition still learns the current
+// state instead of waiting for the next one. The returned channel is buffered
+// so a slow subscriber cannot stall the watchdog; if it fills up, further
+// events are dropped for that subscriber only.
+func (c *QMContext) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+	c.mu.Lock()
+	c.subscribers[ch] = struct{}{}
+	if c.lastEvent != "" {
+		ch <- c.lastEvent
+	}
+	c.mu.Unlock()
+
+	unsubscribe := func() {
+		c.mu.Lock()
+		delete(c.subscribers, ch)
+		c.mu.Unlock()
+		close(ch)
+	}
+	return ch, unsubscribe
+}
+
+// hookTimeout bounds how long a single hook script invocation is allowed to
+// run before it is killed, so that a hanging script (e.g. on-active doing a
+// network call) cannot stall the watchdog loop.
+const hookTimeout = 10 * time.Second
+
+// publish records event as the most recently observed transition, delivers it
+// to every current subscriber, and fires any matching hook script in the
+// background. It never blocks on the hook, so a slow or hanging script only
+// delays its own completion, not the watchdog's next poll or future events.
+func (c *QMContext) publish(event Event) {
+	c.mu.Lock()
+	c.lastEvent = event
+	subscribers := make([]chan Event, 0, len(c.subscribers))
+	for ch := range c.subscribers {
+		subscribers = append(subscribers, ch)
+	}
+	c.mu.Unlock()
+
+	go c.runHook(event)
+
+	for _, ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// runHook executes HookDir/on-<event>, if present, ignoring a missing file.
+// It is always run in its own goroutine by publish and is bounded by
+// hookTimeout, so a slow or hanging hook script only delays its own
+// completion, never the watchdog's next poll or future transitions.
+func (c *QMContext) runHook(event Event) {
+	if c.HookDir == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	script := c.HookDir + "/on-" + hookName(event)
+	cmd := exec.CommandContext(ctx, script)
+	// A missing hook script is the common case and is not an error; any
+	// other failure is the operator's concern, not ours to act on.
+	_ = cmd.Run()
+}
+
+// hookName maps an Event to the lower-case, hyphenated name its hook script
+// is expected to use, e.g. QMStarted -> "active", QMStandby -> "standby".
+func hookName(event Event) string {
+	switch event {
+	case QMStarted:
+		return "active"
+	case QMStandby:
+		return "standby"
+	case QMEnded:
+		return "ended"
+	case SigTerm:
+		return "sigterm"
+	default:
+		return string(event)
+	}
+}
+
+// Run starts the watchdog loop, polling the queue manager's status every
+// PollInterval and publishing an Event whenever it changes, until ctx is
+// cancelled.
+func (c *QMContext) Run(ctx context.Context) {
+	interval := c.PollInterval
+	if interval == 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last Event
+	for {
+		select {
+		case <-ctx.Done():
+			c.publish(SigTerm)
+			return
+		case <-ticker.C:
+			event, err := c.observe()
+			if err != nil || event == last {
+				continue
+			}
+			last = event
+			c.publish(event)
+		}
+	}
+}
+
+// observe runs dspmq and translates its output into the Event it represents.
+func (c *QMContext) observe() (Event, error) {
+	status, err := c.status(c.QMName)
+	if err != nil {
+		return "", err
+	}
+	switch status {
+	case "Running":
+		return QMStarted, nil
+	case "Running as standby":
+		return QMStandby, nil
+	default:
+		// "Running elsewhere", "Ended normally" and every other status dspmq
+		// reports are all treated as QMEnded: none of them mean this
+		// instance is active or standby, and we have no way to distinguish
+		// "my partner is fine and just holds the lock" from "my partner is
+		// unreachable" without a real connectivity check to it, so we don't
+		// claim to.
+		return QMEnded, nil
+	}
+}
+
+// dspmqQueueManagerStatus runs `dspmq -x -o status` for qmName and returns
+// its reported status string.
+func dspmqQueueManagerStatus(qmName string) (string, error) {
+	out, err := exec.Command("dspmq", "-x", "-o", "status", "-m", qmName).Output()
+	if err != nil {
+		return "", err
+	}
+	return parseDspmqStatus(string(out)), nil
+}
@@ -0,0 +1,122 @@
+/*
+© Copyright IBM Corporation 2019
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestQMContextRunDebouncesRepeatedStatus feeds the watchdog a canned
+// sequence of dspmq statuses, including consecutive repeats, and checks that
+// it emits exactly one event per actual state transition rather than one per
+// poll.
+func TestQMContextRunDebouncesRepeatedStatus(t *testing.T) {
+	statuses := []string{
+		"Running as standby",
+		"Running as standby",
+		"Running",
+		"Running",
+		"Running",
+		"Ended normally",
+	}
+	i := 0
+
+	c := NewQMContext("QM1", "")
+	c.PollInterval = 5 * time.Millisecond
+	c.status = func(qmName string) (string, error) {
+		s := statuses[i]
+		if i < len(statuses)-1 {
+			i++
+		}
+		return s, nil
+	}
+
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	for _, want := range []Event{QMStandby, QMStarted, QMEnded} {
+		select {
+		case got := <-events:
+			if got != want {
+				t.Fatalf("got event %v, want %v", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for event %v", want)
+		}
+	}
+}
+
+// TestQMContextSubscribeReplaysLastEvent checks that a subscriber attaching
+// after a transition has already happened still learns the current state,
+// instead of blocking until the next transition.
+func TestQMContextSubscribeReplaysLastEvent(t *testing.T) {
+	c := NewQMContext("QM1", "")
+	c.publish(QMStarted)
+
+	events, unsubscribe := c.Subscribe()
+	defer unsubscribe()
+
+	select {
+	case got := <-events:
+		if got != QMStarted {
+			t.Fatalf("got replayed event %v, want %v", got, QMStarted)
+		}
+	default:
+		t.Fatal("expected the last known event to be replayed immediately on Subscribe")
+	}
+}
+
+// TestQMContextUnsubscribeStopsDelivery checks that a channel returned by
+// Subscribe is closed, and no longer delivered to, once its unsubscribe
+// function has been called.
+func TestQMContextUnsubscribeStopsDelivery(t *testing.T) {
+	c := NewQMContext("QM1", "")
+	events, unsubscribe := c.Subscribe()
+	unsubscribe()
+
+	c.publish(QMStarted)
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed after unsubscribe")
+	}
+}
+
+// TestQMContextPublishDoesNotBlockOnHook checks that publish returns promptly
+// even when the matching hook script hangs, so a slow or hanging hook cannot
+// stall the watchdog's next poll.
+func TestQMContextPublishDoesNotBlockOnHook(t *testing.T) {
+	dir := t.TempDir()
+	hookPath := filepath.Join(dir, "on-active")
+	if err := os.WriteFile(hookPath, []byte("#!/bin/sh\nsleep 5\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewQMContext("QM1", dir)
+
+	start := time.Now()
+	c.publish(QMStarted)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("publish blocked for %v waiting on a hanging hook script", elapsed)
+	}
+}
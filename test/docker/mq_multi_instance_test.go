@@ -16,11 +16,20 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"go.etcd.io/etcd/server/v3/embed"
 )
 
 var miEnv = []string{
@@ -55,11 +64,7 @@ func TestMultiInstanceStartStop(t *testing.T) {
 	}
 
 	killContainer(t, cli, active, "SIGTERM")
-	time.Sleep(2 * time.Second)
-
-	if status := getQueueManagerStatus(t, cli, standby, "QM1"); strings.Compare(status, "Running") != 0 {
-		t.Fatalf("Expected QM1 to be running as active queue manager, dspmq returned status of %v", status)
-	}
+	waitForQMEvent(t, cli, standby, "QMStarted", 30*time.Second)
 
 	startContainer(t, cli, qm1aId)
 	waitForReady(t, cli, qm1aId)
@@ -98,16 +103,161 @@ func TestMultiInstanceContainerStop(t *testing.T) {
 
 	stopContainer(t, cli, active)
 
-	if status := getQueueManagerStatus(t, cli, standby, "QM1"); strings.Compare(status, "Running") != 0 {
-		t.Fatalf("Expected QM1 to be running as active queue manager, dspmq returned status of %v", status)
+	waitForQMEvent(t, cli, standby, "QMStarted", 30*time.Second)
+}
+
+// waitForQMEvent execs into containerId and scans the Server-Sent Events
+// stream from the QMContext supervisor's /qm/events endpoint for an event of
+// the given name, returning as soon as it is seen. The supervisor only emits
+// an event once the corresponding state transition has actually happened, so
+// this gives a deterministic, no-slower-than-necessary signal in place of
+// sleeping a fixed duration and then polling dspmq.
+func waitForQMEvent(t *testing.T, cli *client.Client, containerId string, event string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	execConfig := types.ExecConfig{
+		Cmd:          []string{"curl", "-s", "--unix-socket", "/run/mqm/qm-events.sock", "http://unix/qm/events"},
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	execId, err := cli.ContainerExecCreate(ctx, containerId, execConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := cli.ContainerExecAttach(ctx, execId.ID, types.ExecStartCheck{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+
+	scanner := bufio.NewScanner(resp.Reader)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "event: "+event {
+			return
+		}
+	}
+	t.Fatalf("Timed out after %v waiting for %v event from container %v", timeout, event, containerId)
+}
+
+// startEmbeddedEtcd starts an in-process etcd server for TestMultiInstanceEtcdFailover,
+// returning the running server and the client endpoint its EtcdCoordinator
+// should be pointed at. The server binds to all interfaces so that it is
+// reachable from the containers under test, which run with host networking
+// in this test suite.
+func startEmbeddedEtcd(t *testing.T) (*embed.Etcd, string) {
+	dir, err := ioutil.TempDir("", "mq-container-etcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	clientURL, err := url.Parse("http://0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peerURL, err := url.Parse("http://0.0.0.0:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.LCUrls = []url.URL{*clientURL}
+	cfg.LPUrls = []url.URL{*peerURL}
+
+	etcdServer, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-etcdServer.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		etcdServer.Close()
+		t.Fatal("embedded etcd took too long to become ready")
+	}
+
+	return etcdServer, etcdServer.Clients[0].Addr().String()
+}
+
+// configureMultiInstanceWithEnv creates shared qmsharedlogs/qmshareddata
+// volumes and starts two containers against them with env instead of the
+// package-level miEnv, so tests can exercise non-default configuration (such
+// as MQ_MI_COORDINATOR=etcd) through the same shared-volume startup path as
+// configureMultiInstance.
+func configureMultiInstanceWithEnv(t *testing.T, cli *client.Client, env []string) (error, string, string, []string) {
+	qmsharedlogs := createVolume(t, cli, "qmsharedlogs")
+	qmshareddata := createVolume(t, cli, "qmshareddata")
+	volumes := []string{qmsharedlogs.Name, qmshareddata.Name}
+
+	err, qm1aId, qm1aData := startMultiVolumeQueueManager(t, cli, true, qmsharedlogs.Name, qmshareddata.Name, env)
+	if err != nil {
+		return err, "", "", volumes
+	}
+	volumes = append(volumes, qm1aData)
+
+	err, qm1bId, qm1bData := startMultiVolumeQueueManager(t, cli, true, qmsharedlogs.Name, qmshareddata.Name, env)
+	if err != nil {
+		return err, "", "", volumes
+	}
+	volumes = append(volumes, qm1bData)
+
+	return nil, qm1aId, qm1bId, volumes
+}
+
+// TestMultiInstanceEtcdFailover starts 2 containers configured to coordinate
+// active/standby status via an embedded etcd cluster (MQ_MI_COORDINATOR=etcd)
+// instead of the shared-filesystem lock, kills the active container, and
+// checks the standby promotes itself within the coordination lease's TTL
+func TestMultiInstanceEtcdFailover(t *testing.T) {
+	etcdServer, endpoints := startEmbeddedEtcd(t)
+	defer etcdServer.Close()
+
+	etcdEnv := append([]string{
+		"MQ_MI_COORDINATOR=etcd",
+		"MQ_MI_COORDINATOR_ENDPOINTS=" + endpoints,
+	}, miEnv...)
+
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err, qm1aId, qm1bId, volumes := configureMultiInstanceWithEnv(t, cli, etcdEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, volume := range volumes {
+		defer removeVolume(t, cli, volume)
+	}
+	defer cleanContainer(t, cli, qm1aId)
+	defer cleanContainer(t, cli, qm1bId)
+
+	waitForReady(t, cli, qm1aId)
+	waitForReady(t, cli, qm1bId)
+
+	err, active, standby := getActiveStandbyQueueManager(t, cli, qm1aId, qm1bId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	killContainer(t, cli, active, "SIGKILL")
+
+	const leaseTTL = 10 * time.Second
+	deadline := time.Now().Add(leaseTTL + 5*time.Second)
+	for {
+		if status := getQueueManagerStatus(t, cli, standby, "QM1"); strings.Compare(status, "Running") == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected QM1 to be promoted to active on standby within %v of the active container being killed", leaseTTL)
+		}
+		time.Sleep(500 * time.Millisecond)
 	}
 }
 
 // TestMultiInstanceRace starts 2 containers in separate goroutines in a multi instance queue manager
 // configuration, then checks to ensure that both an active and standby queue manager have been started
 func TestMultiInstanceRace(t *testing.T) {
-	t.Skipf("Skipping %v until file lock is implemented", t.Name())
-
 	cli, err := client.NewEnvClient()
 	if err != nil {
 		t.Fatal(err)
@@ -150,6 +300,76 @@ func TestMultiInstanceRace(t *testing.T) {
 	}
 }
 
+// TestMultiInstanceRaceStress runs several independent instances of the
+// TestMultiInstanceRace scenario concurrently, each against its own pair of
+// shared volumes, to give the FilesystemCoordinator's flock-based
+// coordination many more opportunities to surface a race than a single pair can.
+func TestMultiInstanceRaceStress(t *testing.T) {
+	const numPairs = 5
+
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, numPairs)
+	var wg sync.WaitGroup
+	wg.Add(numPairs)
+	for i := 0; i < numPairs; i++ {
+		go func(pair int) {
+			defer wg.Done()
+			errs <- runMultiInstanceRacePair(t, cli, pair)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// runMultiInstanceRacePair runs a single instance of the TestMultiInstanceRace
+// scenario against a dedicated, uniquely-named pair of shared volumes, so that
+// it can safely be run many times over in parallel by TestMultiInstanceRaceStress.
+func runMultiInstanceRacePair(t *testing.T, cli *client.Client, pair int) error {
+	qmsharedlogs := createVolume(t, cli, fmt.Sprintf("qmsharedlogs-stress-%d", pair))
+	defer removeVolume(t, cli, qmsharedlogs.Name)
+	qmshareddata := createVolume(t, cli, fmt.Sprintf("qmshareddata-stress-%d", pair))
+	defer removeVolume(t, cli, qmshareddata.Name)
+
+	qmsChannel := make(chan QMChan)
+
+	go singleMultiInstanceQueueManager(t, cli, qmsharedlogs.Name, qmshareddata.Name, qmsChannel)
+	go singleMultiInstanceQueueManager(t, cli, qmsharedlogs.Name, qmshareddata.Name, qmsChannel)
+
+	qm1a := <-qmsChannel
+	if qm1a.Error != nil {
+		return qm1a.Error
+	}
+
+	qm1b := <-qmsChannel
+	if qm1b.Error != nil {
+		return qm1b.Error
+	}
+
+	qm1aId, qm1aData := qm1a.QMId, qm1a.QMData
+	qm1bId, qm1bData := qm1b.QMId, qm1b.QMData
+
+	defer removeVolume(t, cli, qm1aData)
+	defer removeVolume(t, cli, qm1bData)
+	defer cleanContainer(t, cli, qm1aId)
+	defer cleanContainer(t, cli, qm1bId)
+
+	waitForReady(t, cli, qm1aId)
+	waitForReady(t, cli, qm1bId)
+
+	err, _, _ := getActiveStandbyQueueManager(t, cli, qm1aId, qm1bId)
+	return err
+}
+
 // TestMultiInstanceNoSharedMounts starts 2 multi instance queue managers without providing shared log/data
 // mounts, then checks to ensure that the container terminates with the expected message
 func TestMultiInstanceNoSharedMounts(t *testing.T) {